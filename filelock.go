@@ -4,21 +4,33 @@ package filelock
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"sync"
-	"syscall"
 	"time"
 )
 
-// File represents an open file descriptor such as os.File. But File always has Posix write lock.
+// File represents an open file descriptor such as os.File. But File always
+// has a Posix lock, shared or exclusive depending on the flag it was
+// opened with.
 type File struct {
 	internalFile
 	name      string
-	absPath   string
+	key       inodeKey
+	exclusive bool
+	isMaster  bool
 	closeOnce sync.Once
 }
 
+// inodeKey identifies a file by the identity of its underlying inode
+// rather than by path, so that hardlinks, symlinks and differently
+// spelled relative paths pointing at the same file are recognized as
+// such.
+type inodeKey struct {
+	dev uint64
+	ino uint64
+}
+
 type internalFile = *os.File
 
 // Open opens the named file with OpenFile for reading by using OpenFile.
@@ -31,42 +43,135 @@ func Open(name string) (*File, error) {
 
 // Create creates or truncates the named file by using OpenFile.
 // If the file already exists, it is truncated.
-// If the file does not exist, it is created with mode 0666 (before umask).
+// If the file does not exist, it is created with mode perm (before umask).
 // When an error occurs, Create returns the error from OpenFile.
 // If LockError occurs, Create will not delete created file.
 // If successful, methods on the returned File can be used for I/O;
 // the associated file descriptor has mode os.O_RDWR.
-func Create(name string) (*File, error) {
-	return OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+func Create(name string, perm os.FileMode) (*File, error) {
+	return OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
 }
 
 // OpenFile opens the named file with specified flag (O_RDONLY etc.) by using os.OpenFile, after locks with Posix lock.
+// O_RDONLY takes a shared lock, allowing any number of concurrent readers;
+// O_WRONLY/O_RDWR take an exclusive lock, allowed only while no reader or
+// writer already holds one.
 // If the file does not exist and the os.O_CREATE flag is passed, it is created with mode perm (before umask).
 // When an error occurs, OpenFile returns the os.OpenFile error or LockError.
 // If the file created with os.O_CREATE flag and LockError occurs, OpenFile will not delete created file.
 // If successful, methods on the returned File can be used for I/O.
 func OpenFile(name string, flag int, perm os.FileMode) (f *File, err error) {
-	absPath, err := filepath.Abs(name)
+	exclusive := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	truncate := flag&os.O_TRUNC != 0
+
+	// O_TRUNC is deferred until the lock is actually held: applying it
+	// up front would truncate the file at the OS level even when the
+	// lock attempt below is rejected with ErrLocked, destroying its
+	// contents out from under whoever currently holds it.
+	f2, err := os.OpenFile(name, flag&^os.O_TRUNC, perm)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get abs path: %w", err)
+		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			_ = f2.Close()
+		}
+	}()
 
-	filesMu.Lock()
-	if _, ok := files[absPath]; ok {
-		filesMu.Unlock()
-		return nil, ErrLocked
+	key, err := fileID(f2)
+	if err != nil {
+		return nil, fmt.Errorf("unable to identify file: %w", err)
+	}
+
+	isMaster, err := acquireSlot(key, exclusive, f2)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			releaseSlot(key, exclusive)
+		}
+	}()
+	if isMaster {
+		ok, lerr := tryLock(f2.Fd(), flag)
+		if lerr != nil {
+			return nil, lerr
+		}
+		if !ok {
+			return nil, ErrLocked
+		}
+	}
+
+	if truncate {
+		if err = f2.Truncate(0); err != nil {
+			return nil, fmt.Errorf("unable to truncate: %w", err)
+		}
+	}
+
+	f = &File{
+		internalFile: f2,
+		name:         name,
+		key:          key,
+		exclusive:    exclusive,
+		isMaster:     isMaster,
+	}
+
+	return f, nil
+}
+
+// OpenFileWithContent is like OpenFile, but once the lock is obtained it
+// truncates the file and writes content to it. This lets a long-running
+// holder record who it is (PID, hostname, start time, or any other
+// caller-defined payload), so ReadHolder can later answer "who holds this
+// lock?" without disturbing the lock itself.
+func OpenFileWithContent(name string, flag int, perm os.FileMode, content []byte) (f *File, err error) {
+	f, err = OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
 	}
-	files[absPath] = nil
-	filesMu.Unlock()
 	defer func() {
 		if err != nil {
-			filesMu.Lock()
-			delete(files, absPath)
-			filesMu.Unlock()
+			_ = f.Close()
 		}
 	}()
 
-	f2, err := os.OpenFile(name, flag, perm)
+	if err = f.Truncate(0); err != nil {
+		return nil, fmt.Errorf("unable to truncate: %w", err)
+	}
+	if _, err = f.WriteAt(content, 0); err != nil {
+		return nil, fmt.Errorf("unable to write content: %w", err)
+	}
+	return f, nil
+}
+
+// ReadHolder returns whatever content the current holder of the named
+// file's lock wrote with OpenFileWithContent. Unlike Read, ReadHolder does
+// not itself take a lock, so it can be used to inspect a file that is
+// currently locked by someone else.
+func ReadHolder(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// LockBlocking opens the named file like OpenFile, but instead of
+// returning ErrLocked immediately when the lock is unavailable, it blocks
+// until the lock is obtained or ctx is done. While another File in this
+// process holds an incompatible lock on the same file, it retries every
+// 50ms. The lock itself is then taken with the blocking F_SETLKW on Linux
+// and a blocking LockFileEx on Windows; on other Unixes and on Plan 9 it
+// is retried every 50ms.
+func LockBlocking(ctx context.Context, name string, flag int, perm os.FileMode) (f *File, err error) {
+	exclusive := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	truncate := flag&os.O_TRUNC != 0
+
+	// O_TRUNC is deferred until the lock is actually held, for the same
+	// reason as in OpenFile: applying it up front would truncate the
+	// file while still waiting to acquire the lock.
+	f2, err := os.OpenFile(name, flag&^os.O_TRUNC, perm)
 	if err != nil {
 		return nil, err
 	}
@@ -76,24 +181,51 @@ func OpenFile(name string, flag int, perm os.FileMode) (f *File, err error) {
 		}
 	}()
 
-	ok, err := posixLock(f2.Fd())
+	key, err := fileID(f2)
+	if err != nil {
+		return nil, fmt.Errorf("unable to identify file: %w", err)
+	}
+
+	var isMaster bool
+	for {
+		isMaster, err = acquireSlot(key, exclusive, f2)
+		if err != ErrLocked {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(defaultMutexPollPeriod):
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
-	if !ok {
-		return nil, ErrLocked
+	defer func() {
+		if err != nil {
+			releaseSlot(key, exclusive)
+		}
+	}()
+	if isMaster {
+		if err = blockingLock(ctx, f2.Fd(), flag); err != nil {
+			return nil, err
+		}
+	}
+
+	if truncate {
+		if err = f2.Truncate(0); err != nil {
+			return nil, fmt.Errorf("unable to truncate: %w", err)
+		}
 	}
 
 	f = &File{
 		internalFile: f2,
 		name:         name,
-		absPath:      absPath,
+		key:          key,
+		exclusive:    exclusive,
+		isMaster:     isMaster,
 	}
 
-	filesMu.Lock()
-	files[absPath] = f
-	filesMu.Unlock()
-
 	return f, nil
 }
 
@@ -119,43 +251,119 @@ func Acquire(ctx context.Context, name string, perm os.FileMode, period time.Dur
 }
 
 // Close closes and unlocks the File.
+//
+// Posix advisory locks are held per (process, inode), not per file
+// descriptor: closing any descriptor open on the same inode releases every
+// lock the process holds on it. To survive that, exactly one File per
+// inode — the one that actually called tryLock/blockingLock, marked by
+// isMaster — pins the Posix lock on behalf of every other File open on
+// that inode; Close only closes its descriptor once the last such File
+// departs. Every other File, including every additional reader, keeps and
+// closes its own independent descriptor, so concurrent Files on the same
+// inode never share a read/write offset.
 func (f *File) Close() (err error) {
-	err = f.internalFile.Close()
 	f.closeOnce.Do(func() {
-		filesMu.Lock()
-		delete(files, f.absPath)
-		filesMu.Unlock()
+		master, last := releaseSlot(f.key, f.exclusive)
+		if !f.isMaster {
+			err = f.internalFile.Close()
+		}
+		if last && master != nil {
+			_ = unlock(master.Fd())
+			if closeErr := master.Close(); err == nil {
+				err = closeErr
+			}
+		}
 	})
 	return
 }
 
-// Release deletes, closes and unlocks the File.
+// Release deletes, closes and unlocks the File. See Close for how the
+// Posix lock on the underlying inode is shared between Files open on it.
 func (f *File) Release() (err error) {
 	f.closeOnce.Do(func() {
 		_ = os.Remove(f.name)
-		err = f.internalFile.Close()
-		filesMu.Lock()
-		delete(files, f.absPath)
-		filesMu.Unlock()
+		master, last := releaseSlot(f.key, f.exclusive)
+		if !f.isMaster {
+			err = f.internalFile.Close()
+		}
+		if last && master != nil {
+			_ = unlock(master.Fd())
+			if closeErr := master.Close(); err == nil {
+				err = closeErr
+			}
+		}
 	})
 	return
 }
 
-var files = make(map[string]*File)
-var filesMu sync.Mutex
+// fileState tracks the readers and writer currently holding the in-process
+// lock on a given inode, mirroring the Posix lock semantics: any number of
+// readers may hold it at once, but a writer requires exclusive access.
+// master is the descriptor the Posix lock was actually taken on; it is
+// kept open by the registry, independent of any individual File, until the
+// last reader or writer departs.
+type fileState struct {
+	master  *os.File
+	writer  bool
+	readers int
+}
 
-func posixLock(fd uintptr) (ok bool, err error) {
-	err = syscall.FcntlFlock(fd, syscall.F_SETLK, &syscall.Flock_t{
-		Type:   syscall.F_WRLCK,
-		Whence: 0,
-		Start:  0,
-		Len:    0,
-	})
-	if err != nil {
-		if err != syscall.EWOULDBLOCK {
-			return false, &LockError{err}
+var (
+	files   = make(map[inodeKey]*fileState)
+	filesMu sync.Mutex
+)
+
+// acquireSlot registers a holder for key. If no holder is registered yet,
+// candidate becomes the master descriptor for key, pinning the Posix lock
+// for every subsequent holder, and acquireSlot reports isMaster == true so
+// the caller still takes the actual Posix lock on it. Otherwise, if the
+// registered holder is compatible with exclusive, acquireSlot registers
+// candidate as an additional holder and reports isMaster == false: the
+// caller keeps and uses candidate for I/O as normal, since only the
+// original master candidate needs to stay pinned. If the registered
+// holder is incompatible, acquireSlot returns ErrLocked.
+func acquireSlot(key inodeKey, exclusive bool, candidate *os.File) (isMaster bool, err error) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	st, ok := files[key]
+	if ok {
+		if exclusive || st.writer {
+			return false, ErrLocked
 		}
+		st.readers++
 		return false, nil
 	}
+
+	st = &fileState{master: candidate}
+	if exclusive {
+		st.writer = true
+	} else {
+		st.readers = 1
+	}
+	files[key] = st
 	return true, nil
 }
+
+// releaseSlot undoes a prior acquireSlot call for key. It reports the
+// master descriptor for key and whether this was the last holder, in
+// which case the caller is responsible for unlocking and closing it.
+func releaseSlot(key inodeKey, exclusive bool) (master *os.File, last bool) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	st, ok := files[key]
+	if !ok {
+		return nil, false
+	}
+	if exclusive {
+		st.writer = false
+	} else {
+		st.readers--
+	}
+	if !st.writer && st.readers == 0 {
+		delete(files, key)
+		return st.master, true
+	}
+	return st.master, false
+}
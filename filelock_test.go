@@ -0,0 +1,97 @@
+package filelock
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestOpenFileReadersWriterContention exercises N concurrent readers and 1
+// writer contending for the same file, in-process. Readers should be able
+// to hold the lock concurrently with each other, but never concurrently
+// with the writer, and OpenFile should report ErrLocked whenever a holder
+// is incompatible with the requester instead of silently corrupting state.
+func TestOpenFileReadersWriterContention(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "contention")
+	if err := os.WriteFile(name, []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	const numReaders = 8
+
+	readers := make([]*File, numReaders)
+	for i := range readers {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatalf("reader %d: Open: %v", i, err)
+		}
+		readers[i] = f
+	}
+
+	if _, err := Create(name, 0666); err != ErrLocked {
+		t.Fatalf("Create while readers hold the lock: got %v, want ErrLocked", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(numReaders)
+	for i, f := range readers {
+		i, f := i, f
+		go func() {
+			defer wg.Done()
+			if _, err := f.ReadAt(make([]byte, 1), 0); err != nil {
+				t.Errorf("reader %d: ReadAt: %v", i, err)
+			}
+			if err := f.Close(); err != nil {
+				t.Errorf("reader %d: Close: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	w, err := Create(name, 0666)
+	if err != nil {
+		t.Fatalf("Create after readers departed: %v", err)
+	}
+	if _, err := Open(name); err != ErrLocked {
+		w.Release()
+		t.Fatalf("Open while writer holds the lock: got %v, want ErrLocked", err)
+	}
+	if err := w.Release(); err != nil {
+		t.Fatalf("writer Release: %v", err)
+	}
+}
+
+// TestOpenFileAcrossProcesses re-runs TestHelperProcess in a subprocess to
+// verify that the exclusive lock taken by Create is also respected across
+// process boundaries, not just by the in-process registry.
+func TestOpenFileAcrossProcesses(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cross-process")
+
+	w, err := Create(name, 0666)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer w.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1", "GO_HELPER_FILE="+name)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("helper process: %v\n%s", err, out)
+	}
+}
+
+// TestHelperProcess is not a real test; it is exec'd by
+// TestOpenFileAcrossProcesses to attempt to lock GO_HELPER_FILE from a
+// separate process and report whether it observed ErrLocked.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	name := os.Getenv("GO_HELPER_FILE")
+	if _, err := Open(name); err != ErrLocked {
+		t.Fatalf("Open(%q) from helper process: got %v, want ErrLocked", name, err)
+	}
+}
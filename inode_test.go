@@ -0,0 +1,95 @@
+package filelock
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestReadConcurrentReadersOwnOffset is a regression test for readers of
+// the same inode sharing a file descriptor (and therefore a read offset):
+// N goroutines calling the package's Read helper on the same file
+// concurrently must each see the whole file, not a truncated read caused
+// by a sibling reader's cursor racing to EOF first.
+func TestReadConcurrentReadersOwnOffset(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "offsets")
+	content := make([]byte, 10000)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	if err := os.WriteFile(name, content, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	const numReaders = 4
+	lengths := make([]int, numReaders)
+	var wg sync.WaitGroup
+	wg.Add(numReaders)
+	for i := range lengths {
+		i := i
+		go func() {
+			defer wg.Done()
+			data, err := Read(name)
+			if err != nil {
+				t.Errorf("reader %d: Read: %v", i, err)
+				return
+			}
+			lengths[i] = len(data)
+		}()
+	}
+	wg.Wait()
+
+	for i, n := range lengths {
+		if n != len(content) {
+			t.Errorf("reader %d: read %d bytes, want %d", i, n, len(content))
+		}
+	}
+}
+
+// TestOpenFileSamePathSpellings verifies that two callers opening the same
+// file through different (but equivalent) path spellings are recognized as
+// contending for the same inode, rather than being treated as unrelated
+// files.
+func TestOpenFileSamePathSpellings(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "same")
+	if err := os.WriteFile(name, []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	altName := dir + string(filepath.Separator) + "." + string(filepath.Separator) + "same"
+
+	w, err := Create(name, 0666)
+	if err != nil {
+		t.Fatalf("Create(%q): %v", name, err)
+	}
+	defer w.Close()
+
+	if _, err := Open(altName); err != ErrLocked {
+		t.Fatalf("Open(%q) while %q is exclusively locked: got %v, want ErrLocked", altName, name, err)
+	}
+}
+
+// TestOpenFileHardlink verifies that two callers opening the same file
+// through a hardlink are recognized as contending for the same inode.
+func TestOpenFileHardlink(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "original")
+	link := filepath.Join(dir, "hardlink")
+	if err := os.WriteFile(name, []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(name, link); err != nil {
+		t.Skipf("hardlinks unsupported: %v", err)
+	}
+
+	w, err := Create(name, 0666)
+	if err != nil {
+		t.Fatalf("Create(%q): %v", name, err)
+	}
+	defer w.Close()
+
+	if _, err := Open(link); err != ErrLocked {
+		t.Fatalf("Open(%q) while hardlinked %q is exclusively locked: got %v, want ErrLocked", link, name, err)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package filelock
+
+import (
+	"context"
+	"runtime"
+	"syscall"
+)
+
+// blockingLock obtains a Posix advisory lock on fd using the blocking
+// F_SETLKW, without busy-polling. F_SETLKW blocks the calling OS thread
+// until the lock is obtained, so the call runs on a dedicated, locked OS
+// thread; if ctx is done first, that thread is interrupted with SIGURG
+// (the same signal the Go runtime uses to preempt goroutines), which
+// aborts the syscall with EINTR.
+func blockingLock(ctx context.Context, fd uintptr, flag int) error {
+	done := make(chan error, 1)
+	tid := make(chan int, 1)
+
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		tid <- syscall.Gettid()
+
+		for {
+			err := setlkw(fd, flag)
+			if err == syscall.EINTR {
+				select {
+				case <-ctx.Done():
+					done <- ctx.Err()
+					return
+				default:
+					continue
+				}
+			}
+			if err != nil {
+				done <- &LockError{err}
+				return
+			}
+			done <- nil
+			return
+		}
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		_ = syscall.Tgkill(syscall.Getpid(), <-tid, syscall.SIGURG)
+		return <-done
+	}
+}
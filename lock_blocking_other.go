@@ -0,0 +1,32 @@
+//go:build unix && !linux
+
+package filelock
+
+import (
+	"context"
+	"time"
+)
+
+// blockingPollPeriod is how often blockingLock retries tryLock on
+// platforms without a practical way to interrupt a blocked F_SETLKW call.
+const blockingPollPeriod = 50 * time.Millisecond
+
+// blockingLock waits until fd is locked or ctx is done. F_SETLKW blocks
+// the calling OS thread uninterruptibly on these platforms, so unlike
+// lock_blocking_linux.go this falls back to polling tryLock.
+func blockingLock(ctx context.Context, fd uintptr, flag int) error {
+	for {
+		ok, err := tryLock(fd, flag)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(blockingPollPeriod):
+		}
+	}
+}
@@ -0,0 +1,99 @@
+//go:build plan9
+
+package filelock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// wrapFd wraps fd in an *os.File for one-off Stat/Chmod calls, without
+// taking ownership of it: os.NewFile arms a finalizer that closes fd when
+// the wrapper is garbage collected, which would close out the real File's
+// shared descriptor from under it. Disarming the finalizer and keeping fd
+// alive for the duration of the caller's use of the wrapper avoids that.
+func wrapFd(fd uintptr) *os.File {
+	f := os.NewFile(fd, "")
+	runtime.SetFinalizer(f, nil)
+	return f
+}
+
+// tryLock obtains Plan 9's only plausible locking primitive: the
+// ModeExclusive file mode bit. Per plan9(5): "Exclusive use files may be
+// open for I/O by only one fid at a time across all clients of the
+// server." Plan 9 has no concept of a shared lock, so a O_RDONLY flag is a
+// no-op; ok is false with a nil error when another fid holds the bit.
+func tryLock(fd uintptr, flag int) (ok bool, err error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return true, nil
+	}
+	f := wrapFd(fd)
+	defer runtime.KeepAlive(f)
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	mode := fi.Mode()
+	if mode&os.ModeExclusive != 0 {
+		return true, nil
+	}
+	if err = f.Chmod(mode | os.ModeExclusive); err != nil {
+		if os.IsPermission(err) || os.IsExist(err) {
+			return false, nil
+		}
+		return false, &LockError{err}
+	}
+	return true, nil
+}
+
+// unlock clears the ModeExclusive bit set by tryLock.
+func unlock(fd uintptr) error {
+	f := wrapFd(fd)
+	defer runtime.KeepAlive(f)
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return f.Chmod(fi.Mode() &^ os.ModeExclusive)
+}
+
+// blockingPollPeriod is how often blockingLock retries tryLock, since
+// Plan 9 has no blocking variant of its ModeExclusive primitive.
+const blockingPollPeriod = 50 * time.Millisecond
+
+// blockingLock waits until fd is locked or ctx is done, polling tryLock.
+func blockingLock(ctx context.Context, fd uintptr, flag int) error {
+	for {
+		ok, err := tryLock(fd, flag)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(blockingPollPeriod):
+		}
+	}
+}
+
+// fileID identifies f's underlying file via its Qid, so that two open file
+// descriptors referring to the same file (including through different
+// relative paths) compare equal.
+func fileID(f *os.File) (inodeKey, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return inodeKey{}, err
+	}
+	dir, ok := fi.Sys().(*syscall.Dir)
+	if !ok {
+		return inodeKey{}, fmt.Errorf("unexpected Sys type %T", fi.Sys())
+	}
+	return inodeKey{dev: uint64(dir.Dev), ino: dir.Qid.Path}, nil
+}
@@ -0,0 +1,70 @@
+//go:build unix
+
+package filelock
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockType reports the fcntl(2) lock type that corresponds to flag:
+// O_RDONLY takes a shared lock, O_WRONLY/O_RDWR take an exclusive one.
+func lockType(flag int) int16 {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return syscall.F_WRLCK
+	}
+	return syscall.F_RDLCK
+}
+
+// tryLock tries to obtain a Posix advisory lock on fd using fcntl(2),
+// shared or exclusive depending on flag. It reports whether the lock was
+// obtained; ok is false with a nil error when the file is already locked
+// incompatibly by another process.
+func tryLock(fd uintptr, flag int) (ok bool, err error) {
+	err = syscall.FcntlFlock(fd, syscall.F_SETLK, &syscall.Flock_t{
+		Type:   lockType(flag),
+		Whence: 0,
+		Start:  0,
+		Len:    0,
+	})
+	if err != nil {
+		if err != syscall.EWOULDBLOCK {
+			return false, &LockError{err}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// unlock releases the Posix advisory lock obtained by tryLock.
+func unlock(fd uintptr) error {
+	return syscall.FcntlFlock(fd, syscall.F_SETLK, &syscall.Flock_t{
+		Type:   syscall.F_UNLCK,
+		Whence: 0,
+		Start:  0,
+		Len:    0,
+	})
+}
+
+// setlkw issues the blocking F_SETLKW fcntl, shared or exclusive depending
+// on flag. It is used by the blockingLock in lock_blocking_linux.go; the
+// blockingLock in lock_blocking_other.go polls tryLock instead.
+func setlkw(fd uintptr, flag int) error {
+	return syscall.FcntlFlock(fd, syscall.F_SETLKW, &syscall.Flock_t{
+		Type:   lockType(flag),
+		Whence: 0,
+		Start:  0,
+		Len:    0,
+	})
+}
+
+// fileID identifies f's underlying inode via fstat(2), so that two open
+// file descriptors referring to the same file (including through
+// hardlinks, symlinks or different relative paths) compare equal.
+func fileID(f *os.File) (inodeKey, error) {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(f.Fd()), &st); err != nil {
+		return inodeKey{}, err
+	}
+	return inodeKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, nil
+}
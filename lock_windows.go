@@ -0,0 +1,77 @@
+//go:build windows
+
+package filelock
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFlags reports the LockFileEx flags that correspond to flag:
+// O_RDONLY takes a shared lock, O_WRONLY/O_RDWR take an exclusive one.
+func lockFlags(flag int) uint32 {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return windows.LOCKFILE_EXCLUSIVE_LOCK | windows.LOCKFILE_FAIL_IMMEDIATELY
+	}
+	return windows.LOCKFILE_FAIL_IMMEDIATELY
+}
+
+// tryLock tries to obtain a lock on fd using LockFileEx with
+// LOCKFILE_FAIL_IMMEDIATELY, shared or exclusive depending on flag. It
+// reports whether the lock was obtained; ok is false with a nil error when
+// the file is already locked incompatibly elsewhere.
+func tryLock(fd uintptr, flag int) (ok bool, err error) {
+	ol := new(windows.Overlapped)
+	err = windows.LockFileEx(windows.Handle(fd), lockFlags(flag), 0, 1, 0, ol)
+	if err != nil {
+		if err == windows.ERROR_LOCK_VIOLATION {
+			return false, nil
+		}
+		return false, &LockError{err}
+	}
+	return true, nil
+}
+
+// unlock releases the lock obtained by tryLock.
+func unlock(fd uintptr) error {
+	ol := new(windows.Overlapped)
+	return windows.UnlockFileEx(windows.Handle(fd), 0, 1, 0, ol)
+}
+
+// blockingLock obtains a lock on fd using LockFileEx without
+// LOCKFILE_FAIL_IMMEDIATELY, so the call blocks instead of busy-polling.
+// If ctx is done before the lock is obtained, the pending I/O is aborted
+// with CancelIoEx.
+func blockingLock(ctx context.Context, fd uintptr, flag int) error {
+	ol := new(windows.Overlapped)
+	done := make(chan error, 1)
+	go func() {
+		done <- windows.LockFileEx(windows.Handle(fd), lockFlags(flag)&^windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return &LockError{err}
+		}
+		return nil
+	case <-ctx.Done():
+		_ = windows.CancelIoEx(windows.Handle(fd), ol)
+		<-done
+		return ctx.Err()
+	}
+}
+
+// fileID identifies f's underlying file via GetFileInformationByHandle, so
+// that two open file descriptors referring to the same file (including
+// through hardlinks or different relative paths) compare equal.
+func fileID(f *os.File) (inodeKey, error) {
+	var info windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(windows.Handle(f.Fd()), &info); err != nil {
+		return inodeKey{}, err
+	}
+	ino := uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow)
+	return inodeKey{dev: uint64(info.VolumeSerialNumber), ino: ino}, nil
+}
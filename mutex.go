@@ -0,0 +1,76 @@
+package filelock
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultMutexPollPeriod is how often Mutex retries the lock file while
+// waiting for it to become available.
+const defaultMutexPollPeriod = 50 * time.Millisecond
+
+// Mutex is an advisory, cross-process mutual exclusion lock backed by the
+// file at Path, analogous to sync.Mutex but shared between independent
+// processes instead of goroutines in the same process.
+type Mutex struct {
+	Path string
+}
+
+// Lock locks m, creating Path if necessary, blocking until the lock is
+// acquired. It returns an unlock function that releases the lock; calling
+// it more than once is a no-op.
+func (m *Mutex) Lock() (unlock func(), err error) {
+	return m.LockContext(context.Background())
+}
+
+// LockContext is like Lock, but fails with ctx's error if ctx is done
+// before the lock can be acquired.
+func (m *Mutex) LockContext(ctx context.Context) (unlock func(), err error) {
+	f, err := OpenFile(m.Path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != ErrLocked {
+		if err != nil {
+			return nil, err
+		}
+		return m.unlockFunc(f), nil
+	}
+
+	tkr := time.NewTicker(defaultMutexPollPeriod)
+	defer tkr.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-tkr.C:
+			f, err = OpenFile(m.Path, os.O_CREATE|os.O_RDWR, 0666)
+			if err != ErrLocked {
+				if err != nil {
+					return nil, err
+				}
+				return m.unlockFunc(f), nil
+			}
+		}
+	}
+}
+
+// TryLock attempts to lock m without blocking. If the lock is already held
+// elsewhere, TryLock returns ErrLocked.
+func (m *Mutex) TryLock() (unlock func(), err error) {
+	f, err := OpenFile(m.Path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return m.unlockFunc(f), nil
+}
+
+// unlockFunc wraps f.Close in an idempotent closure suitable for returning
+// from Lock, LockContext and TryLock.
+func (m *Mutex) unlockFunc(f *File) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			_ = f.Close()
+		})
+	}
+}
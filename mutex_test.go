@@ -0,0 +1,45 @@
+package filelock
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMutexLockContextAcrossHolders is a smoke test that Mutex serializes
+// two goroutines contending for the same path, mirroring the cross-process
+// contention Mutex is designed for.
+func TestMutexLockContextAcrossHolders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mutex")
+	m := &Mutex{Path: path}
+
+	unlock1, err := m.Lock()
+	if err != nil {
+		t.Fatalf("first Lock: %v", err)
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		unlock2, err := m.Lock()
+		if err != nil {
+			t.Errorf("second Lock: %v", err)
+			return
+		}
+		close(locked)
+		unlock2()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("second Lock succeeded while first holder still held the lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock1()
+
+	select {
+	case <-locked:
+	case <-time.After(2 * time.Second):
+		t.Fatal("second Lock did not acquire the lock after it was released")
+	}
+}
@@ -0,0 +1,114 @@
+package filelock
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Read reads the named file's contents while holding a shared lock, so it
+// never observes a partial write made by Write or Transform.
+func Read(name string) ([]byte, error) {
+	f, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Write atomically replaces the named file's contents with data.
+// It takes the exclusive lock on name, then stages data in a temp file in
+// the same directory, fsyncs it and renames the temp file into place, so
+// concurrent readers using Read never observe a partial write.
+func Write(name string, data []byte, perm os.FileMode) error {
+	f, err := OpenFile(name, os.O_WRONLY|os.O_CREATE, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return stageAndRename(name, data, perm)
+}
+
+// stageAndRename writes data to a temp file in name's directory, fsyncs
+// it, and renames it into place over name. The caller is responsible for
+// holding the exclusive lock on name across the call, so that concurrent
+// readers using Read never observe a partial write and concurrent writers
+// never race each other.
+func stageAndRename(name string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if err = tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("unable to chmod temp file: %w", err)
+	}
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("unable to write temp file: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("unable to sync temp file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("unable to close temp file: %w", err)
+	}
+
+	if err = os.Rename(tmpName, name); err != nil {
+		return fmt.Errorf("unable to rename temp file into place: %w", err)
+	}
+	return nil
+}
+
+// Transform atomically updates the named file: it takes the exclusive
+// lock on name and holds it across the entire read-modify-write, reading
+// its current contents under that lock, passing them to fn, and staging
+// fn's result back into place, so no writer (including another Transform
+// or a plain Write) can observe or clobber an update made while the lock
+// was held. If name does not exist yet (or its contents are empty), fn is
+// called with a nil old. If another writer renames a new file over name
+// while Transform is taking the lock, Transform returns ErrLocked without
+// calling fn.
+func Transform(name string, fn func(old []byte) (new []byte, err error), perm os.FileMode) error {
+	f, err := OpenFile(name, os.O_RDWR|os.O_CREATE, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The lock is held on the file OpenFile opened; make sure name still
+	// refers to it, so that stale contents are never written back.
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat: %w", err)
+	}
+	cur, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(fi, cur) {
+		return ErrLocked
+	}
+
+	old, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("unable to read: %w", err)
+	}
+	if len(old) == 0 {
+		old = nil
+	}
+
+	data, err := fn(old)
+	if err != nil {
+		return err
+	}
+
+	return stageAndRename(name, data, perm)
+}